@@ -5,15 +5,26 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"mime"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/artyom/autoflags"
 )
@@ -27,6 +38,8 @@ func main() {
 		FullTag    string `flag:"tag,build tag to use for main generated file"`
 		DevTag     string `flag:"devtag,build tag to assign to development stub"`
 		Package    string `flag:"name,package name"`
+		Compress   bool   `flag:"compress,gzip-compress embedded file data when that shrinks it"`
+		Manifest   string `flag:"manifest,path to a JSON manifest describing assets explicitly, instead of walking directories"`
 	}{
 		DevTag:  "dev",
 		Package: os.Getenv("GOPACKAGE"),
@@ -50,11 +63,24 @@ func main() {
 	if params.DevOutput != "" && params.FullTag == params.DevTag {
 		log.Fatal("normal and dev output should use different tags")
 	}
-	if len(flag.Args()) == 0 {
-		log.Fatal("no asset directories provided")
-	}
-	if err := generateMain(params.FullOutput, params.Package, params.FullTag, flag.Args()); err != nil {
-		log.Fatal(err)
+	if params.Manifest != "" {
+		if len(flag.Args()) != 0 {
+			log.Fatal("-manifest and asset directories are mutually exclusive")
+		}
+		m, err := loadManifest(params.Manifest)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := generateManifest(params.FullOutput, params.Package, params.FullTag, m, params.Compress); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		if len(flag.Args()) == 0 {
+			log.Fatal("no asset directories provided")
+		}
+		if err := generateMain(params.FullOutput, params.Package, params.FullTag, flag.Args(), params.Compress); err != nil {
+			log.Fatal(err)
+		}
 	}
 	if params.DevOutput != "" {
 		if err := generateStub(params.DevOutput, params.Package, params.DevTag); err != nil {
@@ -89,7 +115,7 @@ func generateStub(filename, pkg, tag string) error {
 	return os.Rename(outfile.Name(), filename)
 }
 
-func generateMain(filename, pkg, tag string, dirs []string) error {
+func generateMain(filename, pkg, tag string, dirs []string, compress bool) error {
 	if filename == "" {
 		return errors.New("empty filename")
 	}
@@ -105,7 +131,7 @@ func generateMain(filename, pkg, tag string, dirs []string) error {
 	writer.Write([]byte(head))
 	for _, dir := range dirs {
 		dir = filepath.Clean(dir)
-		if err := writeSection(writer, dir); err != nil {
+		if err := writeSection(writer, dir, compress); err != nil {
 			return err
 		}
 	}
@@ -122,14 +148,221 @@ func generateMain(filename, pkg, tag string, dirs []string) error {
 	return os.Rename(outfile.Name(), filename)
 }
 
-func writeSection(wr io.Writer, dir string) error {
-	fmt.Fprintf(wr, "\t%#q: &_assetfs{\n\t\tdata: [][]byte{\n", dir)
+// manifest describes assets to embed explicitly, as an alternative to walking
+// directories: see the -manifest flag.
+type manifest struct {
+	Files []manifestEntry `json:"files"`
+}
+
+// manifestEntry maps one source file, or a glob matching several, to a
+// destination path in the generated virtual filesystem.
+type manifestEntry struct {
+	Src string `json:"src"`           // source path, or glob pattern matching several
+	Dst string `json:"dst,omitempty"` // destination path; for a glob, must be a directory ending in "/"
+
+	Type   string   `json:"type,omitempty"`   // Content-Type override; detected from Dst when empty
+	Gzip   *bool    `json:"gzip,omitempty"`   // overrides the -compress flag for this entry
+	Base64 bool     `json:"base64,omitempty"` // embed as a base64 literal instead of a raw byte string
+	Tags   []string `json:"tags,omitempty"`   // restrict this entry to these build tags; empty means all
+}
+
+// included reports whether e should be embedded for a build tagged tag.
+func (e manifestEntry) included(tag string) bool {
+	if len(e.Tags) == 0 {
+		return true
+	}
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// loadManifest reads and parses a JSON manifest file.
+func loadManifest(name string) (*manifest, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	m := new(manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("parsing manifest %q: %w", name, err)
+	}
+	return m, nil
+}
+
+func generateManifest(filename, pkg, tag string, m *manifest, compress bool) error {
+	if filename == "" {
+		return errors.New("empty filename")
+	}
+	outfile, err := ioutil.TempFile("", "assetfs-main-tmp.")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(outfile.Name())
+	defer outfile.Close()
+
+	writer := ErrWriter(outfile)
+	writeHeader(writer, pkg, tag)
+	writer.Write([]byte(head))
+	if err := writeManifestSection(writer, m, tag, compress); err != nil {
+		return err
+	}
+	writeTail(writer)
+	if err := writer.Err(); err != nil {
+		return err
+	}
+	if err := outfile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(outfile.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(outfile.Name(), filename)
+}
+
+// writeManifestSection is the manifest-mode counterpart of writeSection: it
+// embeds m.Files, filtered to those matching activeTag, under the virtual
+// root "/", instead of walking a directory tree.
+func writeManifestSection(wr io.Writer, m *manifest, activeTag string, compress bool) error {
+	fmt.Fprintf(wr, "\t%#q: &_assetfs{\n\t\tdata: [][]byte{\n", "/")
 	tr := &tree{
 		wr:      wr,
-		root:    dir,
 		names:   make(map[string]int),
 		dirData: make(map[string]*dirInfo),
 	}
+	tr.ensureDir("/")
+	for _, e := range m.Files {
+		if !e.included(activeTag) {
+			log.Printf("manifest entry %q: excluded, tags %v don't include active tag %q", e.Src, e.Tags, activeTag)
+			continue
+		}
+		glob := strings.ContainsAny(e.Src, "*?[")
+		if glob && e.Dst != "" && !strings.HasSuffix(e.Dst, "/") {
+			return fmt.Errorf("manifest entry %q: dst for a glob must end in \"/\"", e.Src)
+		}
+		matches, err := filepath.Glob(e.Src)
+		if err != nil {
+			return fmt.Errorf("manifest entry %q: %v", e.Src, err)
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("manifest entry %q: no files matched", e.Src)
+		}
+		for _, src := range matches {
+			fi, err := os.Stat(src)
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				log.Printf("manifest entry %q: glob match %q is a directory, skipping", e.Src, src)
+				continue
+			}
+			if fi.Size() > maxFileSize {
+				return fmt.Errorf("file %q size exceeds max allowed size", src)
+			}
+			dst := e.Dst
+			switch {
+			case dst == "":
+				dst = filepath.Base(src)
+			case glob:
+				dst = path.Join(dst, filepath.Base(src))
+			}
+			data, err := ioutil.ReadFile(src)
+			if err != nil {
+				return err
+			}
+			useCompress := compress
+			if e.Gzip != nil {
+				useCompress = *e.Gzip
+			}
+			if err := tr.addManifestFile(dst, fi, data, e.Type, useCompress, e.Base64); err != nil {
+				return fmt.Errorf("manifest entry %q: %v", e.Src, err)
+			}
+		}
+	}
+	tr.writeMetadata()
+	return nil
+}
+
+// addManifestFile embeds data at the virtual path dst, using fi for its mode
+// and modification time; fi.Name() is ignored in favor of dst's own base
+// name, since source and destination names can differ. It errors if dst was
+// already populated by an earlier manifest entry.
+func (tr *tree) addManifestFile(dst string, fi os.FileInfo, data []byte, ctypeOverride string, compress, base64Embed bool) error {
+	dst = path.Clean("/" + dst)
+	if _, ok := tr.names[dst]; ok {
+		return fmt.Errorf("dst %q collides with an earlier manifest entry", dst)
+	}
+	dir := path.Dir(dst)
+	tr.ensureDir(dir)
+	name := path.Base(dst)
+	idx := len(tr.filesMeta)
+	tr.filesMeta = append(tr.filesMeta, renamedFileInfo{FileInfo: fi, name: name})
+	tr.names[dst] = idx
+	if pi, ok := tr.dirData[dir]; ok {
+		pi.files = append(pi.files, idx)
+	}
+	blobIdx := tr.writeBlob(data, compress, base64Embed)
+	ctype := ctypeOverride
+	if ctype == "" {
+		ctype = detectContentType(name, data)
+	}
+	tr.recordFile(idx, blobIdx, ctype)
+	return nil
+}
+
+// ensureDir creates dir, an already "/"-rooted and cleaned virtual path, and
+// any missing ancestors, linking each to its parent's dirInfo, and returns
+// dir's index in tr.dirMeta. Calling it again with the same dir is a no-op.
+func (tr *tree) ensureDir(dir string) int {
+	if idx, ok := tr.names[dir]; ok {
+		if _, isDir := tr.dirData[dir]; isDir {
+			return idx
+		}
+	}
+	idx := len(tr.dirMeta)
+	tr.dirMeta = append(tr.dirMeta, virtualDirInfo{name: path.Base(dir)})
+	tr.names[dir] = idx
+	tr.dirData[dir] = &dirInfo{}
+	if dir != "/" {
+		parent := path.Dir(dir)
+		tr.ensureDir(parent)
+		tr.dirData[parent].subdirs = append(tr.dirData[parent].subdirs, idx)
+	}
+	return idx
+}
+
+// renamedFileInfo overrides Name, letting a manifest entry copy one file's
+// mode and modification time while giving it a different name at its
+// destination.
+type renamedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (r renamedFileInfo) Name() string { return r.name }
+
+// virtualDirInfo is a synthetic os.FileInfo for directories manifest mode
+// creates implicitly, which don't correspond to any real filesystem entry.
+type virtualDirInfo struct{ name string }
+
+func (v virtualDirInfo) Name() string       { return v.name }
+func (v virtualDirInfo) Size() int64        { return 0 }
+func (v virtualDirInfo) Mode() os.FileMode  { return os.ModeDir | 0755 }
+func (v virtualDirInfo) ModTime() time.Time { return time.Time{} }
+func (v virtualDirInfo) IsDir() bool        { return true }
+func (v virtualDirInfo) Sys() interface{}   { return nil }
+
+func writeSection(wr io.Writer, dir string, compress bool) error {
+	fmt.Fprintf(wr, "\t%#q: &_assetfs{\n\t\tdata: [][]byte{\n", dir)
+	tr := &tree{
+		wr:       wr,
+		root:     dir,
+		names:    make(map[string]int),
+		dirData:  make(map[string]*dirInfo),
+		compress: compress,
+	}
 	if err := filepath.Walk(tr.root, tr.walkFunc); err != nil {
 		return err
 	}
@@ -144,6 +377,23 @@ type tree struct {
 	dirMeta   []os.FileInfo
 	names     map[string]int
 	dirData   map[string]*dirInfo
+	compress  bool
+	// encoding holds per-file encoding keyed by filesMeta index
+	encoding map[int]byte
+	// dataIdx maps filesMeta index to the index of its content in the
+	// generated data slice; identical file contents share one entry.
+	dataIdx map[int]int
+	// blobHash maps a content hash to the data slice index already
+	// holding it, used to detect duplicate file contents.
+	blobHash map[[sha256.Size]byte]int
+	// blobEnc records the encoding chosen for each data slice index, so
+	// duplicate files can reuse it without recompressing.
+	blobEnc map[int]byte
+	// blobEtag records the hex-encoded ETag for each data slice index,
+	// computed once when the blob is first written.
+	blobEtag map[int]string
+	// ctype holds the detected Content-Type per filesMeta index.
+	ctype map[int]string
 }
 
 type dirInfo struct {
@@ -151,6 +401,34 @@ type dirInfo struct {
 	subdirs []int
 }
 
+// encNone and encGzip mirror the _encNone/_encGzip constants emitted into
+// generated code, see head.
+const (
+	encNone byte = iota
+	encGzip
+)
+
+// gzipIfSmaller compresses data with gzip and returns the compressed bytes
+// and true if they are smaller than the original, otherwise it returns nil,
+// false and data should be kept as is.
+func gzipIfSmaller(data []byte) ([]byte, bool) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, false
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, false
+	}
+	if err := zw.Close(); err != nil {
+		return nil, false
+	}
+	if buf.Len() >= len(data) {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
 func rootedName(name, root string) string {
 	name = strings.TrimPrefix(name, root)
 	if name == "" {
@@ -177,6 +455,10 @@ func (tr *tree) writeMetadata() {
 		for _, v := range d.subdirs {
 			subIndexes = append(subIndexes, v+dirIdxShift)
 		}
+		// io/fs requires ReadDir results sorted by filename.
+		sort.Slice(subIndexes, func(i, j int) bool {
+			return info[subIndexes[i]].Name() < info[subIndexes[j]].Name()
+		})
 		subdir[rootedName(name, tr.root)] = subIndexes
 	}
 	idx2name := make(map[int]string, len(indexes))
@@ -190,7 +472,11 @@ func (tr *tree) writeMetadata() {
 		fmt.Fprintf(tr.wr, "\t\t\t{name: %#q, mode: %#o, mtime: %d, ",
 			fi.Name(), fi.Mode(), fi.ModTime().UnixNano())
 		if !fi.IsDir() {
-			fmt.Fprintf(tr.wr, "size: %d", fi.Size())
+			fmt.Fprintf(tr.wr, "size: %d, dataIdx: %d, etag: %#q, ctype: %#q",
+				fi.Size(), tr.dataIdx[i], tr.blobEtag[tr.dataIdx[i]], tr.ctype[i])
+			if enc, ok := tr.encoding[i]; ok {
+				fmt.Fprintf(tr.wr, ", encoding: %d", enc)
+			}
 		} else {
 			fmt.Fprint(tr.wr, "isDir: true")
 			children := subdir[idx2name[i]]
@@ -243,11 +529,83 @@ func (tr *tree) walkFunc(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		fmt.Fprintf(tr.wr, "\t\t\t[]byte(%#q),\n", data)
+		blobIdx := tr.writeBlob(data, tr.compress, false)
+		tr.recordFile(idx, blobIdx, detectContentType(path, data))
 	}
 	return nil
 }
 
+// writeBlob writes data (gzip-compressed when compress shrinks it, encoded as
+// base64 when base64Embed is set) to the generated data slice, unless
+// identical content was already written, and returns its index. Dedup keys
+// solely on the hash of data, so the first entry's compress/encoding choice
+// wins for any later duplicates.
+func (tr *tree) writeBlob(data []byte, compress, base64Embed bool) int {
+	hash := sha256.Sum256(data)
+	if blobIdx, known := tr.blobHash[hash]; known {
+		return blobIdx
+	}
+	if tr.blobHash == nil {
+		tr.blobHash = make(map[[sha256.Size]byte]int)
+	}
+	blobIdx := len(tr.blobHash)
+	tr.blobHash[hash] = blobIdx
+	out := data
+	etagSum := hash
+	if compress {
+		if gzipped, ok := gzipIfSmaller(data); ok {
+			if tr.blobEnc == nil {
+				tr.blobEnc = make(map[int]byte)
+			}
+			tr.blobEnc[blobIdx] = encGzip
+			out = gzipped
+			etagSum = sha256.Sum256(out)
+		}
+	}
+	if tr.blobEtag == nil {
+		tr.blobEtag = make(map[int]string)
+	}
+	tr.blobEtag[blobIdx] = hex.EncodeToString(etagSum[:])
+	if base64Embed {
+		fmt.Fprintf(tr.wr, "\t\t\t_mustB64(%#q),\n", base64.StdEncoding.EncodeToString(out))
+	} else {
+		fmt.Fprintf(tr.wr, "\t\t\t[]byte(%#q),\n", out)
+	}
+	return blobIdx
+}
+
+// recordFile associates the filesMeta entry at idx with blobIdx and ctype,
+// carrying over whatever encoding writeBlob chose for that blob.
+func (tr *tree) recordFile(idx, blobIdx int, ctype string) {
+	if tr.dataIdx == nil {
+		tr.dataIdx = make(map[int]int)
+	}
+	tr.dataIdx[idx] = blobIdx
+	if enc, ok := tr.blobEnc[blobIdx]; ok {
+		if tr.encoding == nil {
+			tr.encoding = make(map[int]byte)
+		}
+		tr.encoding[idx] = enc
+	}
+	if tr.ctype == nil {
+		tr.ctype = make(map[int]string)
+	}
+	tr.ctype[idx] = ctype
+}
+
+// detectContentType determines the MIME type of a file the same way
+// net/http's FileServer does: by its name's extension first, falling back to
+// sniffing its content.
+func detectContentType(name string, data []byte) string {
+	if ctype := mime.TypeByExtension(filepath.Ext(name)); ctype != "" {
+		return ctype
+	}
+	if len(data) > 512 {
+		data = data[:512]
+	}
+	return http.DetectContentType(data)
+}
+
 func ErrWriter(w io.Writer) *errWriter { return &errWriter{Writer: w} }
 
 type errWriter struct {
@@ -281,25 +639,254 @@ func init() {
 	}
 }
 
+// overlayCode is shared by both head and stub: it implements a union
+// filesystem on top of http.FileSystem/fs.FS, letting on-disk files shadow
+// embedded ones during development.
+const overlayCode = `
+// Overlay returns an http.FileSystem that opens files from overlay first,
+// falling back to base when a name doesn't exist there. If a name is a
+// directory in both, their listings are merged, with overlay's entries
+// winning name collisions.
+func Overlay(base, overlay http.FileSystem) http.FileSystem {
+	return &_overlayFileSystem{base: base, overlay: overlay}
+}
+
+// LiveOverlay returns root, an on-disk directory, as an http.FileSystem
+// suitable for use as the overlay argument to Overlay, so individual files
+// can be edited without regenerating or rebuilding the embedded assets.
+func LiveOverlay(root string) http.FileSystem { return http.Dir(root) }
+
+type _overlayFileSystem struct{ base, overlay http.FileSystem }
+
+func (o *_overlayFileSystem) Open(name string) (http.File, error) {
+	of, err := o.overlay.Open(name)
+	if err != nil {
+		return o.base.Open(name)
+	}
+	ofi, err := of.Stat()
+	if err != nil || !ofi.IsDir() {
+		return of, err
+	}
+	bf, err := o.base.Open(name)
+	if err != nil {
+		return of, nil
+	}
+	bfi, err := bf.Stat()
+	if err != nil || !bfi.IsDir() {
+		bf.Close()
+		return of, nil
+	}
+	return _mergeDirs(ofi, of, bf)
+}
+
+func _mergeDirs(fi os.FileInfo, of, bf http.File) (http.File, error) {
+	overEntries, err := of.Readdir(-1)
+	if err != nil {
+		of.Close()
+		bf.Close()
+		return nil, err
+	}
+	baseEntries, err := bf.Readdir(-1)
+	of.Close()
+	bf.Close()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(overEntries))
+	entries := make([]os.FileInfo, 0, len(overEntries)+len(baseEntries))
+	for _, e := range overEntries {
+		seen[e.Name()] = true
+		entries = append(entries, e)
+	}
+	for _, e := range baseEntries {
+		if !seen[e.Name()] {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return &_mergedDir{fi: fi, entries: entries}, nil
+}
+
+// _mergedDir implements http.File for the union of two directories' entries.
+type _mergedDir struct {
+	fi      os.FileInfo
+	entries []os.FileInfo
+	read    int
+}
+
+func (d *_mergedDir) Close() error               { return nil }
+func (d *_mergedDir) Stat() (os.FileInfo, error) { return d.fi, nil }
+func (d *_mergedDir) Read([]byte) (int, error)   { return 0, _errOverlayIsDirectory }
+func (d *_mergedDir) Seek(int64, int) (int64, error) {
+	return 0, _errOverlayIsDirectory
+}
+func (d *_mergedDir) Readdir(count int) ([]os.FileInfo, error) {
+	if count <= 0 {
+		out := d.entries[d.read:]
+		d.read = len(d.entries)
+		return out, nil
+	}
+	if d.read >= len(d.entries) {
+		return nil, io.EOF
+	}
+	end := d.read + count
+	if end > len(d.entries) {
+		end = len(d.entries)
+	}
+	out := d.entries[d.read:end]
+	d.read = end
+	return out, nil
+}
+
+var _errOverlayIsDirectory = errors.New("is directory")
+
+// OverlayFS is like Overlay but for io/fs.FS values.
+func OverlayFS(base, overlay fs.FS) fs.FS {
+	return &_overlayFS{base: base, overlay: overlay}
+}
+
+type _overlayFS struct{ base, overlay fs.FS }
+
+func (o *_overlayFS) Open(name string) (fs.File, error) {
+	of, err := o.overlay.Open(name)
+	if err != nil {
+		return o.base.Open(name)
+	}
+	ofi, err := of.Stat()
+	if err != nil || !ofi.IsDir() {
+		return of, err
+	}
+	bf, err := o.base.Open(name)
+	if err != nil {
+		return of, nil
+	}
+	bfi, err := bf.Stat()
+	if err != nil || !bfi.IsDir() {
+		bf.Close()
+		return of, nil
+	}
+	return _mergeFSDirs(ofi, of, bf)
+}
+
+func _mergeFSDirs(fi fs.FileInfo, of, bf fs.File) (fs.File, error) {
+	overEntries, err := _readDirEntries(of)
+	if err != nil {
+		of.Close()
+		bf.Close()
+		return nil, err
+	}
+	baseEntries, err := _readDirEntries(bf)
+	of.Close()
+	bf.Close()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(overEntries))
+	entries := make([]fs.DirEntry, 0, len(overEntries)+len(baseEntries))
+	for _, e := range overEntries {
+		seen[e.Name()] = true
+		entries = append(entries, e)
+	}
+	for _, e := range baseEntries {
+		if !seen[e.Name()] {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return &_mergedFSDir{fi: fi, entries: entries}, nil
+}
+
+func _readDirEntries(f fs.File) ([]fs.DirEntry, error) {
+	d, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return nil, nil
+	}
+	return d.ReadDir(-1)
+}
+
+// _mergedFSDir implements fs.ReadDirFile for the union of two directories'
+// entries.
+type _mergedFSDir struct {
+	fi      fs.FileInfo
+	entries []fs.DirEntry
+	read    int
+}
+
+func (d *_mergedFSDir) Close() error                { return nil }
+func (d *_mergedFSDir) Stat() (fs.FileInfo, error)   { return d.fi, nil }
+func (d *_mergedFSDir) Read([]byte) (int, error)     { return 0, _errOverlayIsDirectory }
+func (d *_mergedFSDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		out := d.entries[d.read:]
+		d.read = len(d.entries)
+		return out, nil
+	}
+	if d.read >= len(d.entries) {
+		return nil, io.EOF
+	}
+	end := d.read + n
+	if end > len(d.entries) {
+		end = len(d.entries)
+	}
+	out := d.entries[d.read:end]
+	d.read = end
+	return out, nil
+}
+`
+
 const stub = `
-import "net/http"
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+)
 
 func AssetDir(name string) http.FileSystem { return http.Dir(name) }
-`
+func AssetFS(name string) fs.FS            { return os.DirFS(name) }
+
+// Handler mirrors the generated Handler, minus the precomputed ETag: dev
+// builds read straight from disk, so net/http derives everything itself.
+func Handler(name string) http.Handler { return http.FileServer(AssetDir(name)) }
+
+// LookupETag mirrors the generated LookupETag. Dev builds have no
+// precomputed ETag to return.
+func LookupETag(fsys http.FileSystem, name string) (string, bool) { return "", false }
+
+` + overlayCode
 
 const head = `
 import (
 	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"errors"
 	"io"
+	"io/fs"
+	"mime"
 	"net/http"
 	"os"
 	"path"
+	"sort"
+	"strings"
 	"time"
 )
 
 func AssetDir(name string) http.FileSystem { return _assetFilesystems[name] }
 
+// _mustB64 decodes a base64-embedded asset, used instead of a raw []byte
+// literal for entries the generator was asked to embed as base64. Generated
+// data is always valid, so decoding errors indicate a generator bug.
+func _mustB64(s string) []byte {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
 // _assetfs implements http.FileSystem interface
 type _assetfs struct {
 	data  [][]byte        // depends on number of files
@@ -326,11 +913,18 @@ func (fs *_assetfs) Open(name string) (http.File, error) {
 		fs: fs,
 	}
 	if !fi.isDir {
-		af.rd = bytes.NewReader(fs.data[i])
+		af.raw = fs.data[fi.dataIdx]
 	}
 	return af, nil
 }
 
+// encoding values stored in _itemMetadata.encoding, describing how the
+// corresponding entry in _assetfs.data is encoded on disk.
+const (
+	_encNone byte = iota
+	_encGzip
+)
+
 // _itemMetadata implements os.FileInfo interface
 type _itemMetadata struct {
 	name     string
@@ -338,7 +932,11 @@ type _itemMetadata struct {
 	mode     os.FileMode
 	mtime    int64
 	isDir    bool
-	children []int // indexes of items in directories
+	encoding byte   // one of _encNone, _encGzip; zero value is _encNone
+	dataIdx  int    // index into _assetfs.data; shared by files with identical content
+	etag     string // hex-encoded SHA-256 of the stored (possibly gzip'd) bytes
+	ctype    string // Content-Type, detected at generation time
+	children []int  // indexes of items in directories
 }
 
 func (m _itemMetadata) Name() string       { return m.name }
@@ -350,7 +948,8 @@ func (m _itemMetadata) Sys() interface{}   { return nil }
 
 // _assetFile implements http.File interface
 type _assetFile struct {
-	rd   *bytes.Reader
+	rd   *bytes.Reader // decompressed content, populated lazily; nil for directories
+	raw  []byte        // bytes as stored in _assetfs.data, nil for directories
 	fi   _itemMetadata
 	fs   *_assetfs
 	read int // how many entries read already by Readdir
@@ -358,6 +957,37 @@ type _assetFile struct {
 
 func (af *_assetFile) Close() error               { return nil } // TODO guard against usage after close?
 func (af *_assetFile) Stat() (os.FileInfo, error) { return af.fi, nil }
+
+// rawBytes returns the bytes as stored in _assetfs.data together with
+// whether they are gzip-compressed, letting callers bypass decompression
+// when they can consume gzip-encoded data directly (see GzipHandler). Unlike
+// Read/Seek, this never triggers decompression.
+func (af *_assetFile) rawBytes() (data []byte, gzipped bool) {
+	return af.raw, af.fi.encoding == _encGzip
+}
+
+// ensureReader populates af.rd on first use, decompressing gzip-encoded
+// content only once a caller actually reads the file instead of consuming
+// af.raw directly (see rawBytes/GzipHandler/Handler).
+func (af *_assetFile) ensureReader() error {
+	if af.rd != nil {
+		return nil
+	}
+	if af.fi.encoding != _encGzip {
+		af.rd = bytes.NewReader(af.raw)
+		return nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(af.raw))
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return err
+	}
+	af.rd = bytes.NewReader(data)
+	return nil
+}
 func (af *_assetFile) Readdir(count int) ([]os.FileInfo, error) {
 	if !af.fi.isDir {
 		return nil, os.ErrInvalid
@@ -390,16 +1020,219 @@ func (af *_assetFile) Seek(offset int64, whence int) (int64, error) {
 	if af.fi.isDir {
 		return 0, _errIsDirectory
 	}
+	if err := af.ensureReader(); err != nil {
+		return 0, err
+	}
 	return af.rd.Seek(offset, whence)
 }
 func (af *_assetFile) Read(p []byte) (int, error) {
 	if af.fi.isDir {
 		return 0, _errIsDirectory
 	}
+	if err := af.ensureReader(); err != nil {
+		return 0, err
+	}
 	return af.rd.Read(p)
 }
 
+// ReadDir implements fs.ReadDirFile in terms of Readdir.
+func (af *_assetFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	infos, err := af.Readdir(n)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]fs.DirEntry, len(infos))
+	for i, fi := range infos {
+		out[i] = fs.FileInfoToDirEntry(fi)
+	}
+	return out, nil
+}
+
 var _errIsDirectory = errors.New("is directory")
 
+// AssetFS is like AssetDir but returns a value implementing fs.FS (along with
+// fs.ReadDirFS, fs.ReadFileFS, fs.StatFS, fs.GlobFS and fs.SubFS), for use
+// with the APIs of the io/fs ecosystem: html/template.ParseFS,
+// text/template.ParseFS, http.FS, testing/fstest and similar.
+func AssetFS(name string) fs.FS { return _assetFSAdapter{fs: _assetFilesystems[name]} }
+
+// _assetFSAdapter adapts _assetfs to the io/fs.FS family of interfaces,
+// translating between the "/"-rooted paths http.FileSystem uses internally
+// and the unrooted, slash-separated paths io/fs expects.
+type _assetFSAdapter struct{ fs *_assetfs }
+
+func (a _assetFSAdapter) Open(name string) (fs.File, error) {
+	iname, err := _fsName(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := a.fs.Open(iname)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: _unwrapPathErr(err)}
+	}
+	return f.(*_assetFile), nil
+}
+
+func (a _assetFSAdapter) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, err := a.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dir, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return dir.ReadDir(-1)
+}
+
+func (a _assetFSAdapter) ReadFile(name string) ([]byte, error) {
+	f, err := a.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func (a _assetFSAdapter) Stat(name string) (fs.FileInfo, error) {
+	f, err := a.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// Glob and Sub delegate to the fs package's generic implementations, wrapping
+// a in a bare fs.FS so those don't just call back into these same methods.
+func (a _assetFSAdapter) Glob(pattern string) ([]string, error) {
+	return fs.Glob(struct{ fs.FS }{a}, pattern)
+}
+
+func (a _assetFSAdapter) Sub(dir string) (fs.FS, error) {
+	return fs.Sub(struct{ fs.FS }{a}, dir)
+}
+
+func _fsName(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return "/", nil
+	}
+	return "/" + name, nil
+}
+
+func _unwrapPathErr(err error) error {
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Err
+	}
+	return err
+}
+
+// GzipHandler returns an http.Handler serving files out of fsys. For clients
+// advertising gzip support in the Accept-Encoding request header, files
+// stored gzip-compressed are written as is with Content-Encoding: gzip set,
+// skipping a decompress step entirely; everything else is served decompressed
+// via http.FileServer.
+func GzipHandler(fsys http.FileSystem) http.Handler {
+	fileServer := http.FileServer(fsys)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !_acceptsGzip(r) {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		f, err := fsys.Open(path.Clean("/" + r.URL.Path))
+		if err != nil {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		raw, ok := f.(interface {
+			rawBytes() (data []byte, gzipped bool)
+		})
+		if !ok {
+			http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+			return
+		}
+		data, gzipped := raw.rawBytes()
+		if !gzipped {
+			http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+			return
+		}
+		if ctype := mime.TypeByExtension(path.Ext(fi.Name())); ctype != "" {
+			w.Header().Set("Content-Type", ctype)
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		http.ServeContent(w, r, fi.Name(), fi.ModTime(), bytes.NewReader(data))
+	})
+}
+
+func _acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(enc) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler returns an http.Handler serving the named asset directory with
+// precomputed ETag, Content-Type and Content-Length, honoring conditional
+// requests (If-None-Match, If-Modified-Since) and negotiating
+// Content-Encoding: gzip with clients that advertise support for it.
+func Handler(name string) http.Handler { return _assetHandler{fs: _assetFilesystems[name]} }
+
+type _assetHandler struct{ fs *_assetfs }
+
+func (h _assetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f, err := h.fs.Open(r.URL.Path)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	af, ok := f.(*_assetFile)
+	if !ok || af.fi.isDir {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if af.fi.ctype != "" {
+		w.Header().Set("Content-Type", af.fi.ctype)
+	}
+	w.Header().Set("ETag", _quoteETag(af.fi.etag))
+	if af.fi.encoding == _encGzip && _acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		http.ServeContent(w, r, af.fi.name, af.fi.ModTime(), bytes.NewReader(af.raw))
+		return
+	}
+	http.ServeContent(w, r, af.fi.name, af.fi.ModTime(), af)
+}
+
+// LookupETag returns the precomputed ETag (already quoted, ready to use as an
+// ETag header value) for name in fsys, for callers composing their own
+// http.Handler on top of AssetDir instead of using Handler.
+func LookupETag(fsys http.FileSystem, name string) (string, bool) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	af, ok := f.(*_assetFile)
+	if !ok || af.fi.isDir {
+		return "", false
+	}
+	return _quoteETag(af.fi.etag), true
+}
+
+func _quoteETag(etag string) string { return "\"" + etag + "\"" }
+
+` + overlayCode + `
 var _assetFilesystems = map[string]*_assetfs{
 `
@@ -1,19 +1,37 @@
+//go:build ignore
 // +build ignore
 
 package assetfs
 
 import (
 	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"errors"
 	"io"
+	"io/fs"
+	"mime"
 	"net/http"
 	"os"
 	"path"
+	"sort"
+	"strings"
 	"time"
 )
 
 func AssetDir(name string) http.FileSystem { return _assetFilesystems[name] }
 
+// _mustB64 decodes a base64-embedded asset, used instead of a raw []byte
+// literal for entries the generator was asked to embed as base64. Generated
+// data is always valid, so decoding errors indicate a generator bug.
+func _mustB64(s string) []byte {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
 // _assetfs implements http.FileSystem interface
 type _assetfs struct {
 	data  [][]byte        // depends on number of files
@@ -40,11 +58,18 @@ func (fs *_assetfs) Open(name string) (http.File, error) {
 		fs: fs,
 	}
 	if !fi.isDir {
-		af.rd = bytes.NewReader(fs.data[i])
+		af.raw = fs.data[fi.dataIdx]
 	}
 	return af, nil
 }
 
+// encoding values stored in _itemMetadata.encoding, describing how the
+// corresponding entry in _assetfs.data is encoded on disk.
+const (
+	_encNone byte = iota
+	_encGzip
+)
+
 // _itemMetadata implements os.FileInfo interface
 type _itemMetadata struct {
 	name     string
@@ -52,7 +77,11 @@ type _itemMetadata struct {
 	mode     os.FileMode
 	mtime    int64
 	isDir    bool
-	children []int // indexes of items in directories
+	encoding byte   // one of _encNone, _encGzip; zero value is _encNone
+	dataIdx  int    // index into _assetfs.data; shared by files with identical content
+	etag     string // hex-encoded SHA-256 of the stored (possibly gzip'd) bytes
+	ctype    string // Content-Type, detected at generation time
+	children []int  // indexes of items in directories
 }
 
 func (m _itemMetadata) Name() string       { return m.name }
@@ -64,7 +93,8 @@ func (m _itemMetadata) Sys() interface{}   { return nil }
 
 // _assetFile implements http.File interface
 type _assetFile struct {
-	rd   *bytes.Reader
+	rd   *bytes.Reader // decompressed content, populated lazily; nil for directories
+	raw  []byte        // bytes as stored in _assetfs.data, nil for directories
 	fi   _itemMetadata
 	fs   *_assetfs
 	read int // how many entries read already by Readdir
@@ -72,6 +102,38 @@ type _assetFile struct {
 
 func (af *_assetFile) Close() error               { return nil } // TODO guard against usage after close?
 func (af *_assetFile) Stat() (os.FileInfo, error) { return af.fi, nil }
+
+// rawBytes returns the bytes as stored in _assetfs.data together with
+// whether they are gzip-compressed, letting callers bypass decompression
+// when they can consume gzip-encoded data directly (see GzipHandler). Unlike
+// Read/Seek, this never triggers decompression.
+func (af *_assetFile) rawBytes() (data []byte, gzipped bool) {
+	return af.raw, af.fi.encoding == _encGzip
+}
+
+// ensureReader populates af.rd on first use, decompressing gzip-encoded
+// content only once a caller actually reads the file instead of consuming
+// af.raw directly (see rawBytes/GzipHandler/Handler).
+func (af *_assetFile) ensureReader() error {
+	if af.rd != nil {
+		return nil
+	}
+	if af.fi.encoding != _encGzip {
+		af.rd = bytes.NewReader(af.raw)
+		return nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(af.raw))
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return err
+	}
+	af.rd = bytes.NewReader(data)
+	return nil
+}
+
 func (af *_assetFile) Readdir(count int) ([]os.FileInfo, error) {
 	if !af.fi.isDir {
 		return nil, os.ErrInvalid
@@ -104,17 +166,409 @@ func (af *_assetFile) Seek(offset int64, whence int) (int64, error) {
 	if af.fi.isDir {
 		return 0, _errIsDirectory
 	}
+	if err := af.ensureReader(); err != nil {
+		return 0, err
+	}
 	return af.rd.Seek(offset, whence)
 }
 func (af *_assetFile) Read(p []byte) (int, error) {
 	if af.fi.isDir {
 		return 0, _errIsDirectory
 	}
+	if err := af.ensureReader(); err != nil {
+		return 0, err
+	}
 	return af.rd.Read(p)
 }
 
+// ReadDir implements fs.ReadDirFile in terms of Readdir.
+func (af *_assetFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	infos, err := af.Readdir(n)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]fs.DirEntry, len(infos))
+	for i, fi := range infos {
+		out[i] = fs.FileInfoToDirEntry(fi)
+	}
+	return out, nil
+}
+
 var _errIsDirectory = errors.New("is directory")
 
+// AssetFS is like AssetDir but returns a value implementing fs.FS (along with
+// fs.ReadDirFS, fs.ReadFileFS, fs.StatFS, fs.GlobFS and fs.SubFS), for use
+// with the APIs of the io/fs ecosystem: html/template.ParseFS,
+// text/template.ParseFS, http.FS, testing/fstest and similar.
+func AssetFS(name string) fs.FS { return _assetFSAdapter{fs: _assetFilesystems[name]} }
+
+// _assetFSAdapter adapts _assetfs to the io/fs.FS family of interfaces,
+// translating between the "/"-rooted paths http.FileSystem uses internally
+// and the unrooted, slash-separated paths io/fs expects.
+type _assetFSAdapter struct{ fs *_assetfs }
+
+func (a _assetFSAdapter) Open(name string) (fs.File, error) {
+	iname, err := _fsName(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := a.fs.Open(iname)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: _unwrapPathErr(err)}
+	}
+	return f.(*_assetFile), nil
+}
+
+func (a _assetFSAdapter) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, err := a.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dir, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return dir.ReadDir(-1)
+}
+
+func (a _assetFSAdapter) ReadFile(name string) ([]byte, error) {
+	f, err := a.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func (a _assetFSAdapter) Stat(name string) (fs.FileInfo, error) {
+	f, err := a.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// Glob and Sub delegate to the fs package's generic implementations, wrapping
+// a in a bare fs.FS so those don't just call back into these same methods.
+func (a _assetFSAdapter) Glob(pattern string) ([]string, error) {
+	return fs.Glob(struct{ fs.FS }{a}, pattern)
+}
+
+func (a _assetFSAdapter) Sub(dir string) (fs.FS, error) {
+	return fs.Sub(struct{ fs.FS }{a}, dir)
+}
+
+func _fsName(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return "/", nil
+	}
+	return "/" + name, nil
+}
+
+func _unwrapPathErr(err error) error {
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Err
+	}
+	return err
+}
+
+// GzipHandler returns an http.Handler serving files out of fsys. For clients
+// advertising gzip support in the Accept-Encoding request header, files
+// stored gzip-compressed are written as is with Content-Encoding: gzip set,
+// skipping a decompress step entirely; everything else is served decompressed
+// via http.FileServer.
+func GzipHandler(fsys http.FileSystem) http.Handler {
+	fileServer := http.FileServer(fsys)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !_acceptsGzip(r) {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		f, err := fsys.Open(path.Clean("/" + r.URL.Path))
+		if err != nil {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		raw, ok := f.(interface {
+			rawBytes() (data []byte, gzipped bool)
+		})
+		if !ok {
+			http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+			return
+		}
+		data, gzipped := raw.rawBytes()
+		if !gzipped {
+			http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+			return
+		}
+		if ctype := mime.TypeByExtension(path.Ext(fi.Name())); ctype != "" {
+			w.Header().Set("Content-Type", ctype)
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		http.ServeContent(w, r, fi.Name(), fi.ModTime(), bytes.NewReader(data))
+	})
+}
+
+func _acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(enc) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler returns an http.Handler serving the named asset directory with
+// precomputed ETag, Content-Type and Content-Length, honoring conditional
+// requests (If-None-Match, If-Modified-Since) and negotiating
+// Content-Encoding: gzip with clients that advertise support for it.
+func Handler(name string) http.Handler { return _assetHandler{fs: _assetFilesystems[name]} }
+
+type _assetHandler struct{ fs *_assetfs }
+
+func (h _assetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f, err := h.fs.Open(r.URL.Path)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	af, ok := f.(*_assetFile)
+	if !ok || af.fi.isDir {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if af.fi.ctype != "" {
+		w.Header().Set("Content-Type", af.fi.ctype)
+	}
+	w.Header().Set("ETag", _quoteETag(af.fi.etag))
+	if af.fi.encoding == _encGzip && _acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		http.ServeContent(w, r, af.fi.name, af.fi.ModTime(), bytes.NewReader(af.raw))
+		return
+	}
+	http.ServeContent(w, r, af.fi.name, af.fi.ModTime(), af)
+}
+
+// LookupETag returns the precomputed ETag (already quoted, ready to use as an
+// ETag header value) for name in fsys, for callers composing their own
+// http.Handler on top of AssetDir instead of using Handler.
+func LookupETag(fsys http.FileSystem, name string) (string, bool) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	af, ok := f.(*_assetFile)
+	if !ok || af.fi.isDir {
+		return "", false
+	}
+	return _quoteETag(af.fi.etag), true
+}
+
+func _quoteETag(etag string) string { return "\"" + etag + "\"" }
+
+// Overlay returns an http.FileSystem that opens files from overlay first,
+// falling back to base when a name doesn't exist there. If a name is a
+// directory in both, their listings are merged, with overlay's entries
+// winning name collisions.
+func Overlay(base, overlay http.FileSystem) http.FileSystem {
+	return &_overlayFileSystem{base: base, overlay: overlay}
+}
+
+// LiveOverlay returns root, an on-disk directory, as an http.FileSystem
+// suitable for use as the overlay argument to Overlay, so individual files
+// can be edited without regenerating or rebuilding the embedded assets.
+func LiveOverlay(root string) http.FileSystem { return http.Dir(root) }
+
+type _overlayFileSystem struct{ base, overlay http.FileSystem }
+
+func (o *_overlayFileSystem) Open(name string) (http.File, error) {
+	of, err := o.overlay.Open(name)
+	if err != nil {
+		return o.base.Open(name)
+	}
+	ofi, err := of.Stat()
+	if err != nil || !ofi.IsDir() {
+		return of, err
+	}
+	bf, err := o.base.Open(name)
+	if err != nil {
+		return of, nil
+	}
+	bfi, err := bf.Stat()
+	if err != nil || !bfi.IsDir() {
+		bf.Close()
+		return of, nil
+	}
+	return _mergeDirs(ofi, of, bf)
+}
+
+func _mergeDirs(fi os.FileInfo, of, bf http.File) (http.File, error) {
+	overEntries, err := of.Readdir(-1)
+	if err != nil {
+		of.Close()
+		bf.Close()
+		return nil, err
+	}
+	baseEntries, err := bf.Readdir(-1)
+	of.Close()
+	bf.Close()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(overEntries))
+	entries := make([]os.FileInfo, 0, len(overEntries)+len(baseEntries))
+	for _, e := range overEntries {
+		seen[e.Name()] = true
+		entries = append(entries, e)
+	}
+	for _, e := range baseEntries {
+		if !seen[e.Name()] {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return &_mergedDir{fi: fi, entries: entries}, nil
+}
+
+// _mergedDir implements http.File for the union of two directories' entries.
+type _mergedDir struct {
+	fi      os.FileInfo
+	entries []os.FileInfo
+	read    int
+}
+
+func (d *_mergedDir) Close() error               { return nil }
+func (d *_mergedDir) Stat() (os.FileInfo, error) { return d.fi, nil }
+func (d *_mergedDir) Read([]byte) (int, error)   { return 0, _errOverlayIsDirectory }
+func (d *_mergedDir) Seek(int64, int) (int64, error) {
+	return 0, _errOverlayIsDirectory
+}
+func (d *_mergedDir) Readdir(count int) ([]os.FileInfo, error) {
+	if count <= 0 {
+		out := d.entries[d.read:]
+		d.read = len(d.entries)
+		return out, nil
+	}
+	if d.read >= len(d.entries) {
+		return nil, io.EOF
+	}
+	end := d.read + count
+	if end > len(d.entries) {
+		end = len(d.entries)
+	}
+	out := d.entries[d.read:end]
+	d.read = end
+	return out, nil
+}
+
+var _errOverlayIsDirectory = errors.New("is directory")
+
+// OverlayFS is like Overlay but for io/fs.FS values.
+func OverlayFS(base, overlay fs.FS) fs.FS {
+	return &_overlayFS{base: base, overlay: overlay}
+}
+
+type _overlayFS struct{ base, overlay fs.FS }
+
+func (o *_overlayFS) Open(name string) (fs.File, error) {
+	of, err := o.overlay.Open(name)
+	if err != nil {
+		return o.base.Open(name)
+	}
+	ofi, err := of.Stat()
+	if err != nil || !ofi.IsDir() {
+		return of, err
+	}
+	bf, err := o.base.Open(name)
+	if err != nil {
+		return of, nil
+	}
+	bfi, err := bf.Stat()
+	if err != nil || !bfi.IsDir() {
+		bf.Close()
+		return of, nil
+	}
+	return _mergeFSDirs(ofi, of, bf)
+}
+
+func _mergeFSDirs(fi fs.FileInfo, of, bf fs.File) (fs.File, error) {
+	overEntries, err := _readDirEntries(of)
+	if err != nil {
+		of.Close()
+		bf.Close()
+		return nil, err
+	}
+	baseEntries, err := _readDirEntries(bf)
+	of.Close()
+	bf.Close()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(overEntries))
+	entries := make([]fs.DirEntry, 0, len(overEntries)+len(baseEntries))
+	for _, e := range overEntries {
+		seen[e.Name()] = true
+		entries = append(entries, e)
+	}
+	for _, e := range baseEntries {
+		if !seen[e.Name()] {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return &_mergedFSDir{fi: fi, entries: entries}, nil
+}
+
+func _readDirEntries(f fs.File) ([]fs.DirEntry, error) {
+	d, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return nil, nil
+	}
+	return d.ReadDir(-1)
+}
+
+// _mergedFSDir implements fs.ReadDirFile for the union of two directories'
+// entries.
+type _mergedFSDir struct {
+	fi      fs.FileInfo
+	entries []fs.DirEntry
+	read    int
+}
+
+func (d *_mergedFSDir) Close() error               { return nil }
+func (d *_mergedFSDir) Stat() (fs.FileInfo, error) { return d.fi, nil }
+func (d *_mergedFSDir) Read([]byte) (int, error)   { return 0, _errOverlayIsDirectory }
+func (d *_mergedFSDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		out := d.entries[d.read:]
+		d.read = len(d.entries)
+		return out, nil
+	}
+	if d.read >= len(d.entries) {
+		return nil, io.EOF
+	}
+	end := d.read + n
+	if end > len(d.entries) {
+		end = len(d.entries)
+	}
+	out := d.entries[d.read:end]
+	d.read = end
+	return out, nil
+}
+
 var _assetFilesystems = map[string]*_assetfs{
 	"static": &_assetfs{
 		data: [][]byte{
@@ -122,8 +576,8 @@ var _assetFilesystems = map[string]*_assetfs{
 			[]byte("cde"),
 		},
 		meta: []_itemMetadata{
-			{name: "red", size: 3, mode: os.FileMode(0644), mtime: 0, isDir: false},
-			{name: "green", size: 3, mode: os.FileMode(0644), mtime: 0, isDir: false},
+			{name: "red", size: 3, dataIdx: 0, etag: "aaaa", ctype: "text/plain; charset=utf-8", mode: os.FileMode(0644), mtime: 0, isDir: false},
+			{name: "green", size: 3, dataIdx: 1, etag: "bbbb", ctype: "text/plain; charset=utf-8", mode: os.FileMode(0644), mtime: 0, isDir: false},
 			{name: "static", mode: os.FileMode(0755), isDir: true, children: []int{0, 1}},
 		},
 		names: map[string]int{